@@ -0,0 +1,232 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package aggregation implements push-sum gossip aggregation on top of
+// gossip.Gossip, giving operators live, cluster-wide numeric summaries
+// (total QPS, replica counts, disk usage, and the like) without a
+// central collector.
+//
+// Each node holds a running (sum, weight) pair per registered key,
+// initialized to (value, 1). Every round it halves its pair, sends one
+// half to a random peer, keeps the other half, and adds any half it
+// receives into its own pair. The ratio sum/weight is an estimate of
+// the cluster-wide average of value across all nodes that converges
+// exponentially quickly. Only this average is estimated: every node
+// seeds its pair with weight 1, so a key whose provider returns 1 on
+// every node estimates 1, not the node count, and no sum, count,
+// min/max or quantile estimate is provided.
+package aggregation
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/cockroach/gossip"
+)
+
+// historyLen bounds how many recent estimates are kept per key for the
+// purpose of computing a confidence score from their variance.
+const historyLen = 10
+
+// defaultRoundInterval is used when no interval is given to Start.
+const defaultRoundInterval = 500 * time.Millisecond
+
+// pair is a node's push-sum state for one key.
+type pair struct {
+	s, w float64
+}
+
+func (p pair) value() float64 {
+	if p.w == 0 {
+		return 0
+	}
+	return p.s / p.w
+}
+
+// Aggregator runs push-sum aggregation for a single gossip node. A node
+// running multiple aggregated metrics shares one Aggregator, registering
+// each metric under its own key.
+type Aggregator struct {
+	g *gossip.Gossip
+
+	mu        sync.Mutex
+	providers map[string]func() float64
+	pairs     map[string]pair
+	history   map[string][]float64
+	stopper   chan struct{}
+	rnd       *rand.Rand
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[*gossip.Gossip]*Aggregator{}
+)
+
+// New creates an Aggregator for g. Callers must call Register for each
+// metric they want aggregated, then Start to begin exchanging updates
+// with peers.
+func New(g *gossip.Gossip) *Aggregator {
+	a := &Aggregator{
+		g:         g,
+		providers: make(map[string]func() float64),
+		pairs:     make(map[string]pair),
+		history:   make(map[string][]float64),
+		stopper:   make(chan struct{}),
+		rnd:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	registryMu.Lock()
+	registry[g] = a
+	registryMu.Unlock()
+	return a
+}
+
+// Register adds a locally computed metric to the set this node
+// aggregates. provider is called once, at registration time, to seed
+// this node's initial (value, 1) pair, which is added to any halves
+// peers already pushed for key; subsequent pushes from peers are
+// folded into the running pair, not re-read from provider.
+func (a *Aggregator) Register(key string, provider func() float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, registered := a.providers[key]; !registered {
+		p := a.pairs[key]
+		p.s += provider()
+		p.w++
+		a.pairs[key] = p
+	}
+	a.providers[key] = provider
+}
+
+// Estimate returns the current cluster-wide estimate for key and a
+// confidence score in [0, 1] derived from how much the estimate has
+// moved over its recent history -- low variance across recent rounds
+// indicates the push-sum process has converged.
+func (a *Aggregator) Estimate(key string) (value float64, confidence float64, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	p, ok := a.pairs[key]
+	if !ok {
+		return 0, 0, fmt.Errorf("aggregation: unknown key %q", key)
+	}
+	return p.value(), confidenceFromHistory(a.history[key]), nil
+}
+
+// Start begins exchanging push-sum updates with a random peer once per
+// interval. It returns immediately; call Stop to terminate.
+func (a *Aggregator) Start(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultRoundInterval
+	}
+	go a.loop(interval)
+}
+
+// Stop terminates this aggregator's round loop and deregisters it.
+func (a *Aggregator) Stop() {
+	close(a.stopper)
+	registryMu.Lock()
+	delete(registry, a.g)
+	registryMu.Unlock()
+}
+
+func (a *Aggregator) loop(interval time.Duration) {
+	for {
+		select {
+		case <-a.stopper:
+			return
+		case <-time.After(interval):
+			a.round()
+		}
+	}
+}
+
+// round halves every registered key's pair, keeps one half, and pushes
+// the other half to a single randomly chosen peer's Aggregator.
+func (a *Aggregator) round() {
+	peers := a.g.Peers()
+	if len(peers) == 0 {
+		return
+	}
+
+	a.mu.Lock()
+	peer := peers[a.rnd.Intn(len(peers))]
+	halves := make(map[string]pair, len(a.pairs))
+	for k, p := range a.pairs {
+		half := pair{s: p.s / 2, w: p.w / 2}
+		halves[k] = half
+		a.pairs[k] = half
+	}
+	a.mu.Unlock()
+
+	registryMu.Lock()
+	peerAgg := registry[peer]
+	registryMu.Unlock()
+	if peerAgg == nil {
+		// The peer hasn't registered an Aggregator; the push is simply
+		// lost, same as a dropped packet would be on a real transport.
+		return
+	}
+	peerAgg.receive(halves)
+}
+
+// receive folds incoming (s, w) halves from a peer's round into this
+// node's own pairs, creating an entry for any key not yet locally
+// registered.
+func (a *Aggregator) receive(halves map[string]pair) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for k, h := range halves {
+		p := a.pairs[k]
+		p.s += h.s
+		p.w += h.w
+		a.pairs[k] = p
+		a.recordHistoryLocked(k, p.value())
+	}
+}
+
+// recordHistoryLocked appends value to key's bounded history. Callers
+// must hold a.mu.
+func (a *Aggregator) recordHistoryLocked(key string, value float64) {
+	h := append(a.history[key], value)
+	if len(h) > historyLen {
+		h = h[len(h)-historyLen:]
+	}
+	a.history[key] = h
+}
+
+// confidenceFromHistory maps the variance of recent estimates to a
+// score in (0, 1]: a flat history (the process has converged) scores
+// close to 1, a history still swinging between pushes scores low. Fewer
+// than two samples yields zero confidence, since variance is undefined.
+func confidenceFromHistory(history []float64) float64 {
+	if len(history) < 2 {
+		return 0
+	}
+	var mean float64
+	for _, v := range history {
+		mean += v
+	}
+	mean /= float64(len(history))
+
+	var variance float64
+	for _, v := range history {
+		d := v - mean
+		variance += d * d
+	}
+	variance /= float64(len(history))
+
+	return 1 / (1 + variance)
+}
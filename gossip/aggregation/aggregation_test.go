@@ -0,0 +1,91 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package aggregation_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/gossip/aggregation"
+	"github.com/cockroachdb/cockroach/gossip/simulation"
+	"github.com/cockroachdb/cockroach/util"
+	"github.com/cockroachdb/cockroach/util/leaktest"
+)
+
+// TestAggregationConverges verifies that push-sum aggregation over a
+// small simulated gossip network converges to the true cluster-wide
+// mean of a metric within a bounded number of rounds, without any
+// central collector.
+func TestAggregationConverges(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	const numNodes = 5
+	values := []float64{10, 20, 30, 40, 50}
+	var want float64
+	for _, v := range values {
+		want += v
+	}
+	want /= float64(len(values))
+
+	network := simulation.NewNetwork(numNodes)
+	defer network.Stop()
+	network.RunUntilFullyConnected()
+
+	aggregators := make([]*aggregation.Aggregator, numNodes)
+	for i, node := range network.Nodes {
+		v := values[i]
+		a := aggregation.New(node.Gossip)
+		a.Register("test.metric", func() float64 { return v })
+		a.Start(time.Millisecond)
+		aggregators[i] = a
+	}
+	defer func() {
+		for _, a := range aggregators {
+			a.Stop()
+		}
+	}()
+
+	util.SucceedsSoon(t, func() error {
+		for i, a := range aggregators {
+			got, confidence, err := a.Estimate("test.metric")
+			if err != nil {
+				return err
+			}
+			if math.Abs(got-want) > 1 {
+				return util.Errorf("node %d: estimate %f has not converged to mean %f", i, got, want)
+			}
+			if confidence < 0.9 {
+				return util.Errorf("node %d: confidence %f too low to consider converged", i, confidence)
+			}
+		}
+		return nil
+	})
+}
+
+// TestAggregationUnknownKey verifies that Estimate reports an error for
+// a key that was never registered, rather than returning a zero value
+// indistinguishable from a legitimate estimate.
+func TestAggregationUnknownKey(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	network := simulation.NewNetwork(1)
+	defer network.Stop()
+
+	a := aggregation.New(network.Nodes[0].Gossip)
+	if _, _, err := a.Estimate("does.not.exist"); err == nil {
+		t.Fatal("expected an error for an unregistered key")
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gossip
+
+import "time"
+
+// defaultMinBootstrapInterval is the MinInterval used by
+// defaultBootstrapPolicy, and thus the starting point for backoff when
+// no policy has been configured.
+const defaultMinBootstrapInterval = 1 * time.Second
+
+// defaultMaxBootstrapInterval bounds how long backoff is allowed to
+// stretch the wait between bootstrap cycles.
+const defaultMaxBootstrapInterval = 1 * time.Minute
+
+// AddressStats is the recent dialing history for a single candidate
+// bootstrap address, used by a Scorer to rank candidates.
+type AddressStats struct {
+	Successes   int
+	Failures    int
+	LastLatency time.Duration
+}
+
+// Scorer ranks a bootstrap address candidate by its recent dialing
+// history; bootstrapAddresses tries higher-scoring candidates first.
+type Scorer interface {
+	Score(stats AddressStats) float64
+}
+
+// defaultScorer favors addresses with a good recent success record and
+// penalizes higher dial latency: the score is the number of successes
+// minus twice the number of failures, less the last dial latency in
+// seconds. An address that has never been tried scores neutrally (0),
+// so it ranks behind one that scores above zero and ahead of one whose
+// failures and latency bring it below zero.
+type defaultScorer struct{}
+
+// Score implements Scorer.
+func (defaultScorer) Score(s AddressStats) float64 {
+	score := float64(s.Successes) - 2*float64(s.Failures)
+	if s.LastLatency > 0 {
+		score -= s.LastLatency.Seconds()
+	}
+	return score
+}
+
+// BootstrapPolicy configures how a Gossip instance paces and orders its
+// bootstrap attempts: how quickly it retries after failures, how much
+// jitter to add so that many nodes don't retry in lockstep, how many
+// candidate addresses it's willing to dial in a single cycle, and how
+// those candidates are ordered.
+type BootstrapPolicy struct {
+	// MinInterval is the wait before the first bootstrap cycle, and the
+	// starting point for backoff after a failed one. The bootstrap loop
+	// ends once a cycle succeeds.
+	MinInterval time.Duration
+	// MaxInterval bounds the exponential backoff applied after
+	// consecutive failed cycles.
+	MaxInterval time.Duration
+	// JitterFraction adds up to +/- this fraction of the computed
+	// interval, chosen uniformly at random.
+	JitterFraction float64
+	// MaxAttemptsPerCycle caps how many candidate addresses are dialed
+	// in a single cycle. This keeps a long tail of historically
+	// unreachable addresses from crowding out a live one within the
+	// same cycle; across a few cycles, failing addresses sink in the
+	// Scorer's ranking and live ones surface.
+	MaxAttemptsPerCycle int
+	// Scorer ranks candidate addresses; higher scores are tried first.
+	Scorer Scorer
+}
+
+// defaultBootstrapPolicy is used by New and as the basis for filling in
+// zero-valued fields passed to SetBootstrapPolicy.
+func defaultBootstrapPolicy() BootstrapPolicy {
+	return BootstrapPolicy{
+		MinInterval:         defaultMinBootstrapInterval,
+		MaxInterval:         defaultMaxBootstrapInterval,
+		JitterFraction:      0.25,
+		MaxAttemptsPerCycle: 2,
+		Scorer:              defaultScorer{},
+	}
+}
@@ -0,0 +1,574 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package gossip implements a simple peer-to-peer gossip protocol that
+// cluster nodes use to disseminate metadata (node descriptors, store
+// capacities, range leases, and the like) without a central coordinator.
+package gossip
+
+import (
+	"crypto/ed25519"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/cockroach/gossip/resolver"
+	"github.com/cockroachdb/cockroach/util"
+)
+
+// Dialer is implemented by whatever transport Gossip uses to reach other
+// gossip instances. In a running cluster this wraps the node's RPC
+// context; tests typically supply an in-memory implementation (see the
+// simulation package).
+type Dialer interface {
+	// Dial connects to the gossip instance listening at addr and returns
+	// its peer-facing handle.
+	Dial(addr net.Addr) (*Gossip, error)
+}
+
+// Gossip is a single node's participant in the cluster-wide gossip
+// network. It maintains a set of connected peers, bootstraps new
+// connections when the node has too few, and persists a snapshot of
+// known peers to Storage so that a restarted node can rejoin without
+// waiting to be re-introduced by its resolvers.
+type Gossip struct {
+	Addr util.UnresolvedAddr
+
+	// Connected is closed the first time this node successfully
+	// establishes a connection to another member of the gossip network.
+	Connected chan struct{}
+
+	mu              sync.Mutex
+	nodeID          NodeID
+	dialer          Dialer
+	resolvers       []resolver.Resolver
+	resolverIdx     int
+	bootstrapPolicy BootstrapPolicy
+	addrStats       map[string]*AddressStats // addr.String() -> recent dialing history
+	consecFailures  int
+	networkChange   chan struct{}
+	storage         Storage
+	peers           map[string]*Gossip // addr.String() -> peer
+	rt              *routingTable
+	connectOnce     sync.Once
+	stopper         chan struct{}
+	stopped         bool
+
+	signingPub     ed25519.PublicKey
+	signingKey     ed25519.PrivateKey
+	trustedSigners map[string]struct{} // hex(pubkey) -> struct{}; empty means "any valid signature"
+}
+
+// New creates a Gossip instance bound to addr. The returned instance is
+// inert until Start is called.
+func New(addr util.UnresolvedAddr) *Gossip {
+	g := &Gossip{
+		Addr:            addr,
+		Connected:       make(chan struct{}),
+		bootstrapPolicy: defaultBootstrapPolicy(),
+		addrStats:       make(map[string]*AddressStats),
+		networkChange:   make(chan struct{}, 1),
+		peers:           make(map[string]*Gossip),
+		stopper:         make(chan struct{}),
+	}
+	g.nodeID = newNodeID(addr)
+	g.rt = newRoutingTable(g.nodeID)
+	g.signingPub, g.signingKey = newSigningKey()
+	return g
+}
+
+// SetDialer installs the transport used to reach other gossip
+// instances during bootstrap.
+func (g *Gossip) SetDialer(d Dialer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.dialer = d
+}
+
+// SetResolvers replaces the ordered list of resolvers consulted when
+// this node has no live peers and nothing usable in its BootstrapInfo.
+func (g *Gossip) SetResolvers(resolvers []resolver.Resolver) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.resolvers = resolvers
+	g.resolverIdx = 0
+}
+
+// SetBootstrapInterval configures this node to retry bootstrap cycles
+// at a fixed interval, with no backoff or jitter. It's a convenience
+// wrapper around SetBootstrapPolicy for callers (and tests) that just
+// want a constant cadence; see SetBootstrapPolicy for adaptive backoff
+// and address scoring.
+func (g *Gossip) SetBootstrapInterval(interval time.Duration) {
+	g.SetBootstrapPolicy(BootstrapPolicy{
+		MinInterval: interval,
+		MaxInterval: interval,
+	})
+}
+
+// SetBootstrapPolicy replaces this node's bootstrap pacing and address
+// ordering strategy. A zero-valued MinInterval, MaxInterval,
+// MaxAttemptsPerCycle or Scorer is filled in from the default policy,
+// so callers can override just the fields they care about; a zero
+// JitterFraction is kept and means no jitter.
+func (g *Gossip) SetBootstrapPolicy(policy BootstrapPolicy) {
+	d := defaultBootstrapPolicy()
+	if policy.MinInterval <= 0 {
+		policy.MinInterval = d.MinInterval
+	}
+	if policy.MaxInterval <= 0 {
+		policy.MaxInterval = d.MaxInterval
+	}
+	if policy.MaxInterval < policy.MinInterval {
+		policy.MaxInterval = policy.MinInterval
+	}
+	if policy.MaxAttemptsPerCycle <= 0 {
+		policy.MaxAttemptsPerCycle = d.MaxAttemptsPerCycle
+	}
+	if policy.Scorer == nil {
+		policy.Scorer = d.Scorer
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.bootstrapPolicy = policy
+	g.consecFailures = 0
+}
+
+// NotifyNetworkChange wakes the bootstrap loop immediately instead of
+// waiting out its current backoff interval. Callers hook this up to
+// whatever signals a change in network reachability is likely (e.g. a
+// NIC coming back up), since a newly reachable address is otherwise
+// only retried on the next scheduled cycle.
+func (g *Gossip) NotifyNetworkChange() {
+	select {
+	case g.networkChange <- struct{}{}:
+	default:
+	}
+}
+
+// SetStorage installs the persistent store used to save and recover
+// BootstrapInfo across restarts. If the store already has contacts
+// recorded, they're folded into this node's routing table immediately:
+// the bucketed contacts when it has any, otherwise its flat Addresses.
+func (g *Gossip) SetStorage(storage Storage) error {
+	g.mu.Lock()
+	g.storage = storage
+	g.mu.Unlock()
+
+	var info BootstrapInfo
+	if err := storage.ReadBootstrapInfo(&info); err != nil {
+		return err
+	}
+	if err := g.verifyBootstrapInfo(&info); err != nil {
+		// The stored addresses failed to verify -- either altered since
+		// they were signed, or (if SetTrustedSigners was configured)
+		// signed by a key that isn't trusted. Rather than fail the
+		// whole SetStorage call (this node's own ability to persist
+		// and serve future bootstrap info is unaffected), simply
+		// decline to seed the routing table from them and fall back to
+		// the configured resolvers.
+		return nil
+	}
+	g.mu.Lock()
+	if len(info.Buckets) > 0 {
+		for _, b := range info.Buckets {
+			for _, addr := range b.Contacts {
+				g.rt.Insert(newNodeID(addr), addr)
+			}
+		}
+	} else {
+		for _, addr := range info.Addresses {
+			g.rt.Insert(newNodeID(addr), addr)
+		}
+	}
+	g.mu.Unlock()
+	return nil
+}
+
+// Start launches the periodic bootstrap loop. It returns immediately;
+// bootstrap attempts continue in the background until a cycle connects
+// this node to a peer or Stop is called.
+func (g *Gossip) Start() {
+	go g.bootstrapLoop()
+}
+
+// Stop terminates the bootstrap loop. Existing peer connections are
+// left in place, in this node's peer set and in its peers' sets alike.
+func (g *Gossip) Stop() {
+	g.mu.Lock()
+	if g.stopped {
+		g.mu.Unlock()
+		return
+	}
+	g.stopped = true
+	g.mu.Unlock()
+	close(g.stopper)
+}
+
+// bootstrapLoop repeatedly attempts to acquire a peer connection until
+// a cycle succeeds or the node is stopped. Each cycle first tries contacts recorded in the routing
+// table (persisted bootstrap info or previously discovered peers),
+// falling back to the configured resolvers. The wait between cycles
+// backs off exponentially (with jitter) after consecutive failures, and
+// can be cut short by NotifyNetworkChange.
+func (g *Gossip) bootstrapLoop() {
+	for {
+		g.mu.Lock()
+		interval := g.nextIntervalLocked()
+		g.mu.Unlock()
+
+		select {
+		case <-g.stopper:
+			return
+		case <-g.networkChange:
+		case <-time.After(interval):
+		}
+
+		if g.tryBootstrap() {
+			return
+		}
+	}
+}
+
+// nextIntervalLocked computes this cycle's wait, given the current
+// bootstrap policy and the number of consecutive failed cycles. g.mu
+// must be held.
+func (g *Gossip) nextIntervalLocked() time.Duration {
+	p := g.bootstrapPolicy
+	backoff := p.MinInterval
+	for i := 0; i < g.consecFailures && backoff < p.MaxInterval; i++ {
+		backoff *= 2
+	}
+	if backoff > p.MaxInterval {
+		backoff = p.MaxInterval
+	}
+	if p.JitterFraction > 0 {
+		jitter := 1 + p.JitterFraction*(2*rand.Float64()-1)
+		backoff = time.Duration(float64(backoff) * jitter)
+		if backoff < 0 {
+			backoff = p.MinInterval
+		}
+	}
+	return backoff
+}
+
+// tryBootstrap attempts a single bootstrap cycle, returning true if the
+// node is now connected to the gossip network.
+func (g *Gossip) tryBootstrap() bool {
+	g.mu.Lock()
+	if len(g.peers) > 0 {
+		g.mu.Unlock()
+		return true
+	}
+	dialer := g.dialer
+	maxAttempts := g.bootstrapPolicy.MaxAttemptsPerCycle
+	g.mu.Unlock()
+	if dialer == nil {
+		return false
+	}
+
+	// Drive iterative FIND_NODE-style lookups toward our own ID (to
+	// fill in buckets near our position, the ones bootstrapAddresses
+	// draws from first) and toward a random ID (to fill in buckets
+	// elsewhere in the space that direct dialing alone wouldn't
+	// reach), before picking this cycle's addresses.
+	g.lookup(dialer, g.nodeID)
+	g.lookup(dialer, randomNodeID())
+
+	addrs := g.bootstrapAddresses()
+	if maxAttempts > 0 && maxAttempts < len(addrs) {
+		addrs = addrs[:maxAttempts]
+	}
+
+	connected := false
+	for _, addr := range addrs {
+		if g.connectTo(dialer, addr) {
+			connected = true
+			break
+		}
+	}
+
+	g.mu.Lock()
+	if connected {
+		g.consecFailures = 0
+	} else {
+		g.consecFailures++
+	}
+	g.mu.Unlock()
+	return connected
+}
+
+// lookupAlpha bounds how many of a lookup's closest, not-yet-queried
+// candidates are dialed per round -- the Kademlia "alpha" parameter.
+const lookupAlpha = 3
+
+// randomNodeID returns a uniformly random identifier, used to drive a
+// lookup toward an arbitrary point in the ID space rather than this
+// node's own, so buckets far from its own position get populated too.
+func randomNodeID() NodeID {
+	var id NodeID
+	rand.Read(id[:])
+	return id
+}
+
+// findNode answers a FIND_NODE-style query from another node with up to
+// n of g's own contacts closest to target. In a running cluster this
+// would be served over RPC; the simulation's in-process Dialer lets a
+// caller invoke it directly on the *Gossip returned by Dial.
+func (g *Gossip) findNode(target NodeID, n int) []contact {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.rt.Closest(target, n)
+}
+
+// lookup performs an iterative Kademlia-style FIND_NODE lookup toward
+// target, seeded from this node's own routing table: each round it
+// dials the closest not-yet-queried candidates, asks each (via
+// findNode) for its own closest contacts to target, and inserts
+// whatever comes back into this node's routing table and the candidate
+// shortlist. It stops once a round fails to turn up a contact closer to
+// target than the best already known -- the standard Kademlia
+// termination condition. This is how a node populates buckets far from
+// its immediate bootstrap contacts, rather than relying solely on
+// whoever it directly dials via bootstrapAddresses.
+func (g *Gossip) lookup(dialer Dialer, target NodeID) {
+	if dialer == nil {
+		return
+	}
+	g.mu.Lock()
+	shortlist := g.rt.Closest(target, bucketSize)
+	g.mu.Unlock()
+
+	queried := make(map[string]bool)
+	for {
+		var candidates []contact
+		for _, c := range shortlist {
+			if !queried[c.addr.String()] {
+				candidates = append(candidates, c)
+			}
+		}
+		if len(candidates) == 0 {
+			return
+		}
+		if len(candidates) > lookupAlpha {
+			candidates = candidates[:lookupAlpha]
+		}
+
+		before := closestXorDistance(shortlist, target)
+		for _, c := range candidates {
+			queried[c.addr.String()] = true
+			peer, err := dialer.Dial(&c.addr)
+			if err != nil {
+				continue
+			}
+			for _, found := range peer.findNode(target, bucketSize) {
+				if found.id == g.nodeID {
+					continue
+				}
+				g.mu.Lock()
+				g.rt.Insert(found.id, found.addr)
+				g.mu.Unlock()
+			}
+		}
+
+		g.mu.Lock()
+		shortlist = g.rt.Closest(target, bucketSize)
+		g.mu.Unlock()
+
+		if !lessID(closestXorDistance(shortlist, target), before) {
+			return
+		}
+	}
+}
+
+// bootstrapAddresses returns the set of addresses to try this cycle:
+// the routing table's contacts (persisted bootstrap info or previously
+// discovered peers) plus the configured resolvers, ordered by the
+// bootstrap policy's Scorer so that addresses with a recent history of
+// reachability are tried ahead of ones that have recently failed.
+func (g *Gossip) bootstrapAddresses() []util.UnresolvedAddr {
+	g.mu.Lock()
+
+	seen := make(map[string]bool)
+	var addrs []util.UnresolvedAddr
+	for _, c := range g.rt.Closest(g.nodeID, g.rt.Len()) {
+		if key := c.addr.String(); !seen[key] {
+			seen[key] = true
+			addrs = append(addrs, c.addr)
+		}
+	}
+	for _, r := range g.resolvers {
+		netAddr, err := r.GetAddress()
+		if err != nil {
+			continue
+		}
+		ua := util.MakeUnresolvedAddr(netAddr.Network(), netAddr.String())
+		if key := ua.String(); !seen[key] {
+			seen[key] = true
+			addrs = append(addrs, ua)
+		}
+	}
+
+	scorer := g.bootstrapPolicy.Scorer
+	stats := g.addrStats
+	g.mu.Unlock()
+
+	sort.SliceStable(addrs, func(i, j int) bool {
+		return scorer.Score(statsFor(stats, addrs[i])) > scorer.Score(statsFor(stats, addrs[j]))
+	})
+	return addrs
+}
+
+// statsFor returns the recorded AddressStats for addr, or the zero
+// value if it has never been attempted.
+func statsFor(stats map[string]*AddressStats, addr util.UnresolvedAddr) AddressStats {
+	if s, ok := stats[addr.String()]; ok {
+		return *s
+	}
+	return AddressStats{}
+}
+
+// connectTo dials addr and, on success, wires up a bidirectional peer
+// connection and merges in the peer's known contacts. Either way, the
+// outcome and latency are recorded so future calls to bootstrapAddresses
+// can rank addr accordingly.
+func (g *Gossip) connectTo(dialer Dialer, addr util.UnresolvedAddr) bool {
+	if addr.String() == g.Addr.String() {
+		return false
+	}
+	start := time.Now()
+	peer, err := dialer.Dial(&addr)
+	g.recordAttempt(addr, err == nil, time.Since(start))
+	if err != nil {
+		return false
+	}
+	g.addPeer(peer)
+	peer.addPeer(g)
+	g.mergeContactsFrom(peer)
+	return true
+}
+
+// recordAttempt updates addr's dialing history after a bootstrap
+// attempt.
+func (g *Gossip) recordAttempt(addr util.UnresolvedAddr, success bool, latency time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s, ok := g.addrStats[addr.String()]
+	if !ok {
+		s = &AddressStats{}
+		g.addrStats[addr.String()] = s
+	}
+	if success {
+		s.Successes++
+	} else {
+		s.Failures++
+	}
+	s.LastLatency = latency
+}
+
+// addPeer registers peer as a connected node, closes Connected the
+// first time this happens, and persists the updated BootstrapInfo each
+// time a new peer is added.
+func (g *Gossip) addPeer(peer *Gossip) {
+	g.mu.Lock()
+	if _, ok := g.peers[peer.Addr.String()]; ok {
+		g.mu.Unlock()
+		return
+	}
+	g.peers[peer.Addr.String()] = peer
+	g.rt.Insert(peer.nodeID, peer.Addr)
+	g.mu.Unlock()
+
+	g.connectOnce.Do(func() { close(g.Connected) })
+	g.persistBootstrapInfo()
+}
+
+// mergeContactsFrom folds peer's known peers into this node's routing
+// table and, transitively, connects to any not already known. This
+// lets a small cluster converge to a full mesh the way the legacy
+// flat-list bootstrap did.
+func (g *Gossip) mergeContactsFrom(peer *Gossip) {
+	peer.mu.Lock()
+	dialer := g.dialer
+	var others []*Gossip
+	for _, p := range peer.peers {
+		others = append(others, p)
+	}
+	peer.mu.Unlock()
+
+	for _, other := range others {
+		if other.Addr.String() == g.Addr.String() {
+			continue
+		}
+		g.mu.Lock()
+		_, known := g.peers[other.Addr.String()]
+		g.mu.Unlock()
+		if known {
+			continue
+		}
+		if dialer != nil {
+			g.connectTo(dialer, other.Addr)
+		}
+	}
+}
+
+// persistBootstrapInfo writes the current routing table contents to
+// Storage, if configured.
+func (g *Gossip) persistBootstrapInfo() {
+	g.mu.Lock()
+	storage := g.storage
+	info := g.rt.bootstrapInfo()
+	g.mu.Unlock()
+
+	if storage == nil {
+		return
+	}
+	if err := g.signBootstrapInfo(&info); err != nil {
+		return
+	}
+	if err := storage.WriteBootstrapInfo(&info); err != nil {
+		// Best-effort: a failed persist doesn't affect the already
+		// established in-memory connections, only the node's ability
+		// to reconnect quickly after a restart.
+		return
+	}
+}
+
+// PeerAddrs returns the addresses of all currently connected peers.
+func (g *Gossip) PeerAddrs() []util.UnresolvedAddr {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	addrs := make([]util.UnresolvedAddr, 0, len(g.peers))
+	for _, p := range g.peers {
+		addrs = append(addrs, p.Addr)
+	}
+	return addrs
+}
+
+// Peers returns the set of currently connected peer Gossip instances.
+// It's used by subsystems layered on top of gossip (e.g. the
+// aggregation package) that need to exchange messages directly with
+// peers rather than just knowing their addresses.
+func (g *Gossip) Peers() []*Gossip {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	peers := make([]*Gossip, 0, len(g.peers))
+	for _, p := range g.peers {
+		peers = append(peers, p)
+	}
+	return peers
+}
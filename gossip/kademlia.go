@@ -0,0 +1,216 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gossip
+
+import (
+	"crypto/sha1"
+	"sort"
+	"sync"
+
+	"github.com/cockroachdb/cockroach/util"
+)
+
+// idBits is the size of the Kademlia-style identifier space: a 160-bit
+// hash of a node's address, matching the SHA-1 digest size.
+const idBits = sha1.Size * 8
+
+// bucketSize (k) bounds the number of contacts retained per bucket. Once
+// a bucket is full, the least-recently-seen contact is evicted in favor
+// of the newly observed one.
+const bucketSize = 8
+
+// NodeID is a node's position in the Kademlia identifier space.
+type NodeID [sha1.Size]byte
+
+// newNodeID derives a NodeID by hashing addr's network and string
+// representation. Using a hash of the address (rather than requiring a
+// separately assigned identifier) keeps bootstrapping self-contained:
+// any two nodes that know an address can agree on its ID.
+func newNodeID(addr util.UnresolvedAddr) NodeID {
+	h := sha1.Sum([]byte(addr.Network() + "/" + addr.String()))
+	return NodeID(h)
+}
+
+// xorDistance returns the XOR distance between two identifiers.
+func xorDistance(a, b NodeID) NodeID {
+	var d NodeID
+	for i := range a {
+		d[i] = a[i] ^ b[i]
+	}
+	return d
+}
+
+// bucketIndexForDistance returns which of the idBits k-buckets a contact at
+// distance d from this node falls into: the index of its most
+// significant set bit, counting from the low end. A zero distance (a
+// node's distance to itself) is not meaningful and callers must not
+// pass it.
+func bucketIndexForDistance(d NodeID) int {
+	for i, b := range d {
+		if b == 0 {
+			continue
+		}
+		for bit := 7; bit >= 0; bit-- {
+			if b&(1<<uint(bit)) != 0 {
+				return idBits - 1 - (i*8 + (7 - bit))
+			}
+		}
+	}
+	return 0
+}
+
+// contact is a single entry in a k-bucket: a peer's identifier and the
+// address used to reach it.
+type contact struct {
+	id   NodeID
+	addr util.UnresolvedAddr
+}
+
+// routingTable is a Kademlia-style set of k-buckets, indexed by XOR
+// distance from self. It replaces the flat, unstructured address list
+// previously persisted via BootstrapInfo.Addresses, giving restarting
+// nodes a distance-balanced set of contacts to reconnect through
+// instead of an arbitrary subset of the full mesh.
+type routingTable struct {
+	mu      sync.Mutex
+	self    NodeID
+	buckets [idBits][]contact // index 0 = nearest, idBits-1 = farthest
+}
+
+// newRoutingTable creates an empty routing table for a node identified
+// by self.
+func newRoutingTable(self NodeID) *routingTable {
+	return &routingTable{self: self}
+}
+
+// Insert records addr (identified by id) as a contact, evicting the
+// least-recently-seen entry from its bucket if the bucket is already at
+// capacity. Re-inserting a known contact moves it to the
+// most-recently-seen position.
+func (rt *routingTable) Insert(id NodeID, addr util.UnresolvedAddr) {
+	if id == rt.self {
+		return
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	idx := bucketIndexForDistance(xorDistance(rt.self, id))
+	bucket := rt.buckets[idx]
+	for i, c := range bucket {
+		if c.id == id {
+			bucket = append(bucket[:i], bucket[i+1:]...)
+			break
+		}
+	}
+	bucket = append(bucket, contact{id: id, addr: addr})
+	if len(bucket) > bucketSize {
+		bucket = bucket[1:]
+	}
+	rt.buckets[idx] = bucket
+}
+
+// Len returns the total number of contacts across all buckets.
+func (rt *routingTable) Len() int {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	n := 0
+	for _, b := range rt.buckets {
+		n += len(b)
+	}
+	return n
+}
+
+// Closest returns up to n contacts ordered by increasing XOR distance
+// from target. It's used both to pick bootstrap candidates (target =
+// self, i.e. prefer contacts most likely still part of the cluster
+// around this node's own position) and to seed and re-rank the
+// shortlist in Gossip.lookup's iterative FIND_NODE lookups toward an
+// arbitrary target.
+func (rt *routingTable) Closest(target NodeID, n int) []contact {
+	rt.mu.Lock()
+	var all []contact
+	for _, b := range rt.buckets {
+		all = append(all, b...)
+	}
+	rt.mu.Unlock()
+
+	sort.Slice(all, func(i, j int) bool {
+		di := xorDistance(target, all[i].id)
+		dj := xorDistance(target, all[j].id)
+		return lessID(di, dj)
+	})
+	if n < len(all) {
+		all = all[:n]
+	}
+	return all
+}
+
+// lessID reports whether a represents a smaller unsigned integer than
+// b, comparing byte-by-byte from the most significant end.
+func lessID(a, b NodeID) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+// maxNodeID returns the largest possible identifier, used as a sentinel
+// "infinitely far" distance when a contact list is empty.
+func maxNodeID() NodeID {
+	var id NodeID
+	for i := range id {
+		id[i] = 0xff
+	}
+	return id
+}
+
+// closestXorDistance returns the XOR distance from target to the
+// nearest of contacts (as returned by Closest, already sorted by
+// increasing distance), or the maximum possible distance if contacts is
+// empty.
+func closestXorDistance(contacts []contact, target NodeID) NodeID {
+	if len(contacts) == 0 {
+		return maxNodeID()
+	}
+	return xorDistance(target, contacts[0].id)
+}
+
+// bootstrapInfo snapshots the routing table into a BootstrapInfo ready
+// to persist: one bucket entry per non-empty k-bucket, plus the flat
+// Addresses list (the union of all buckets) retained for compatibility
+// with callers that only care about the full known peer set.
+func (rt *routingTable) bootstrapInfo() BootstrapInfo {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	var info BootstrapInfo
+	for idx, b := range rt.buckets {
+		if len(b) == 0 {
+			continue
+		}
+		var contacts []util.UnresolvedAddr
+		for _, c := range b {
+			contacts = append(contacts, c.addr)
+			info.Addresses = append(info.Addresses, c.addr)
+		}
+		info.Buckets = append(info.Buckets, BootstrapBucket{
+			Index:    idx,
+			Contacts: contacts,
+		})
+	}
+	return info
+}
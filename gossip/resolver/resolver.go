@@ -0,0 +1,70 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package resolver provides facilities for resolving gossip bootstrap
+// addresses, either supplied statically (e.g. on the command line) or
+// recovered from persistent storage.
+package resolver
+
+import (
+	"net"
+
+	"github.com/cockroachdb/cockroach/util"
+)
+
+// Resolver is the interface implemented by objects capable of producing
+// addresses of nodes which a gossip instance can use to bootstrap its
+// connection to the cluster. A Resolver may be queried repeatedly; once
+// it has nothing further to offer, IsExhausted returns true.
+type Resolver interface {
+	// Type returns the short name identifying the resolver's address
+	// source (e.g. "tcp", "http-lb", "unresolved").
+	Type() string
+	// Addr returns a string representation of the address or address
+	// source this resolver was constructed from, for logging purposes.
+	Addr() string
+	// GetAddress returns the next address to try, or an error if none
+	// remain.
+	GetAddress() (net.Addr, error)
+	// IsExhausted returns true if the resolver has no further addresses
+	// to offer.
+	IsExhausted() bool
+}
+
+// fixedAddressResolver always resolves to the same, single address. It
+// never reports itself as exhausted, since a fixed address is retried
+// indefinitely during bootstrap.
+type fixedAddressResolver struct {
+	addr util.UnresolvedAddr
+}
+
+// NewResolverFromAddress creates a Resolver which always resolves to
+// addr.
+func NewResolverFromAddress(addr util.UnresolvedAddr) (Resolver, error) {
+	return &fixedAddressResolver{addr: addr}, nil
+}
+
+// Type implements the Resolver interface.
+func (fr *fixedAddressResolver) Type() string { return fr.addr.Network() }
+
+// Addr implements the Resolver interface.
+func (fr *fixedAddressResolver) Addr() string { return fr.addr.String() }
+
+// GetAddress implements the Resolver interface.
+func (fr *fixedAddressResolver) GetAddress() (net.Addr, error) {
+	return &fr.addr, nil
+}
+
+// IsExhausted implements the Resolver interface.
+func (fr *fixedAddressResolver) IsExhausted() bool { return false }
@@ -0,0 +1,156 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gossip
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/cockroachdb/cockroach/util"
+)
+
+// bootstrapInfoDigest computes a deterministic digest over the portion
+// of a BootstrapInfo that signBootstrapInfo/verifyBootstrapInfo sign and
+// verify: the address and bucket contents, excluding the signature
+// fields themselves. The contents are canonicalized (sorted) first, so
+// that the digest depends only on the set of addresses a BootstrapInfo
+// names, not on the incidental order its slices happen to be in -- a
+// caller that reads a copy back out of storage and reorders it (e.g.
+// sorting it for comparison in a test) must not thereby invalidate the
+// signature.
+func bootstrapInfoDigest(info *BootstrapInfo) ([]byte, error) {
+	addrs := append([]util.UnresolvedAddr(nil), info.Addresses...)
+	sort.Sort(addrByNetworkAndString(addrs))
+
+	buckets := make([]BootstrapBucket, len(info.Buckets))
+	for i, b := range info.Buckets {
+		contacts := append([]util.UnresolvedAddr(nil), b.Contacts...)
+		sort.Sort(addrByNetworkAndString(contacts))
+		buckets[i] = BootstrapBucket{Index: b.Index, Contacts: contacts}
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Index < buckets[j].Index })
+
+	payload := struct {
+		Addresses interface{}
+		Buckets   interface{}
+	}{addrs, buckets}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+// addrByNetworkAndString sorts util.UnresolvedAddr values into a
+// canonical order for digest purposes.
+type addrByNetworkAndString []util.UnresolvedAddr
+
+func (s addrByNetworkAndString) Len() int      { return len(s) }
+func (s addrByNetworkAndString) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s addrByNetworkAndString) Less(i, j int) bool {
+	if s[i].Network() != s[j].Network() {
+		return s[i].Network() < s[j].Network()
+	}
+	return s[i].String() < s[j].String()
+}
+
+// signBootstrapInfo signs info's address and bucket contents with g's
+// node key, populating SignerKey and Signature.
+func (g *Gossip) signBootstrapInfo(info *BootstrapInfo) error {
+	digest, err := bootstrapInfoDigest(info)
+	if err != nil {
+		return err
+	}
+	info.SignerKey = []byte(g.signingPub)
+	info.Signature = ed25519.Sign(g.signingKey, digest)
+	return nil
+}
+
+// SetTrustedSigners pins the set of node public keys whose signed
+// BootstrapInfo this node will accept. Until this is called, any
+// internally-consistent signature is accepted -- verification only
+// catches a BootstrapInfo that was altered after signing, not one
+// forged from scratch by a party who mints its own key pair, since
+// nothing ties SignerKey to a specific cluster member. Operators are
+// expected to wire this up to the cluster CA or an equivalent trusted
+// key distribution mechanism; this package does not provide one, and
+// newSigningKey's keys are not persisted or published anywhere, so
+// pinning real cluster keys is not yet possible with what's here.
+func (g *Gossip) SetTrustedSigners(keys ...ed25519.PublicKey) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.trustedSigners == nil {
+		g.trustedSigners = make(map[string]struct{})
+	}
+	for _, k := range keys {
+		g.trustedSigners[hex.EncodeToString(k)] = struct{}{}
+	}
+}
+
+// verifyBootstrapInfo checks that info carries a signature and that it
+// is both internally consistent (i.e. the address/bucket contents haven't been
+// altered since it was signed) and, once SetTrustedSigners has pinned a
+// set of keys, produced by one of them. Without a pinned set, this is
+// an integrity check against after-the-fact tampering, not an
+// authentication check against who signed it -- see SetTrustedSigners.
+// Empty info (as returned by a store with nothing persisted yet) is
+// always accepted.
+func (g *Gossip) verifyBootstrapInfo(info *BootstrapInfo) error {
+	if len(info.Addresses) == 0 && len(info.Buckets) == 0 {
+		return nil
+	}
+	if len(info.Signature) == 0 || len(info.SignerKey) == 0 {
+		return fmt.Errorf("gossip: bootstrap info has addresses but no signature")
+	}
+	digest, err := bootstrapInfoDigest(info)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(ed25519.PublicKey(info.SignerKey), digest, info.Signature) {
+		return fmt.Errorf("gossip: bootstrap info signature does not verify; refusing its addresses")
+	}
+
+	g.mu.Lock()
+	trusted := g.trustedSigners
+	g.mu.Unlock()
+	if len(trusted) > 0 {
+		if _, ok := trusted[hex.EncodeToString(info.SignerKey)]; !ok {
+			return fmt.Errorf("gossip: bootstrap info signed by untrusted key %x", info.SignerKey)
+		}
+	}
+	return nil
+}
+
+// newSigningKey generates a fresh Ed25519 node key pair. It is neither
+// persisted across restarts nor published anywhere, so a node's
+// SignerKey changes every time it starts; SetTrustedSigners cannot yet
+// be used to pin a node's long-term identity, only to restrict
+// acceptance to a set of keys an operator has obtained out of band for
+// the lifetime of those keys.
+func newSigningKey() (ed25519.PublicKey, ed25519.PrivateKey) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		// crypto/rand failing indicates a broken host environment; there
+		// is no sane way for a node to run without entropy.
+		panic(err)
+	}
+	return pub, priv
+}
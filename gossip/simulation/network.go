@@ -0,0 +1,164 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package simulation provides an in-memory gossip network, used by
+// tests that need several gossip.Gossip instances wired together
+// without the overhead of real network connections.
+package simulation
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/cockroach/gossip"
+	"github.com/cockroachdb/cockroach/gossip/resolver"
+	"github.com/cockroachdb/cockroach/util"
+)
+
+// Node is a single simulated gossip participant.
+type Node struct {
+	Addr   util.UnresolvedAddr
+	Gossip *gossip.Gossip
+}
+
+// Network wires a set of Node instances together in memory, acting as
+// the gossip.Dialer each node uses to reach the others.
+type Network struct {
+	Nodes []*Node
+
+	mu       sync.Mutex
+	registry map[string]*gossip.Gossip
+	nextID   int
+}
+
+// NewNetwork creates numNodes simulated nodes. All but the first are
+// given the first node's address as their sole resolver, so that
+// starting the network causes them to converge to a fully connected
+// mesh via gossip peer-exchange, the way a freshly bootstrapped cluster
+// would.
+func NewNetwork(numNodes int) *Network {
+	n := &Network{registry: make(map[string]*gossip.Gossip)}
+	for i := 0; i < numNodes; i++ {
+		node := n.newNode()
+		n.Nodes = append(n.Nodes, node)
+	}
+	if len(n.Nodes) > 1 {
+		seed := n.Nodes[0].Addr
+		for _, node := range n.Nodes[1:] {
+			r, err := resolver.NewResolverFromAddress(seed)
+			if err != nil {
+				panic(err)
+			}
+			node.Gossip.SetResolvers([]resolver.Resolver{r})
+		}
+	}
+	for _, node := range n.Nodes {
+		node.Gossip.Start()
+	}
+	return n
+}
+
+// newNode allocates a new simulated node and registers it with the
+// network's in-memory dialer, but does not start its bootstrap loop.
+func (n *Network) newNode() *Node {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	addr := util.MakeUnresolvedAddr("sim", fmt.Sprintf("node%d", n.nextID))
+	n.nextID++
+
+	node := &Node{Addr: addr, Gossip: gossip.New(addr)}
+	node.Gossip.SetDialer(n)
+	n.registry[addr.String()] = node.Gossip
+	return node
+}
+
+// CreateNode allocates a new simulated node without starting it,
+// allowing a test to configure resolvers before the bootstrap loop
+// begins.
+func (n *Network) CreateNode() (*Node, error) {
+	return n.newNode(), nil
+}
+
+// StartNode begins node's bootstrap loop.
+func (n *Network) StartNode(node *Node) error {
+	node.Gossip.Start()
+	return nil
+}
+
+// StopNode halts node's bootstrap loop and removes it from the
+// network's dialer registry, simulating a node leaving the cluster for
+// good (as opposed to Network.Stop, which halts every node but leaves
+// them dialable for inspection). Addresses recorded for node in other
+// nodes' BootstrapInfo become unreachable afterward.
+func (n *Network) StopNode(node *Node) {
+	node.Gossip.Stop()
+	n.mu.Lock()
+	delete(n.registry, node.Addr.String())
+	n.mu.Unlock()
+}
+
+// Dial implements gossip.Dialer.
+func (n *Network) Dial(addr net.Addr) (*gossip.Gossip, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	g, ok := n.registry[addr.String()]
+	if !ok {
+		return nil, fmt.Errorf("simulation: no node listening at %s", addr)
+	}
+	return g, nil
+}
+
+// Stop halts every node's bootstrap loop.
+func (n *Network) Stop() {
+	for _, node := range n.Nodes {
+		node.Gossip.Stop()
+	}
+}
+
+// RunUntilFullyConnected blocks until every node has a peer connection
+// to every other node, or until a generous timeout elapses.
+func (n *Network) RunUntilFullyConnected() {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if n.isFullyConnected() {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (n *Network) isFullyConnected() bool {
+	for _, node := range n.Nodes {
+		if len(node.Gossip.PeerAddrs()) != len(n.Nodes)-1 {
+			return false
+		}
+	}
+	return true
+}
+
+// SimulateNetwork repeatedly invokes fn, once per simulated cycle,
+// until fn returns false.
+func (n *Network) SimulateNetwork(fn func(cycle int, network *Network) bool) {
+	cycle := 0
+	for {
+		cycle++
+		if !fn(cycle, n) {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gossip
+
+import (
+	"fmt"
+
+	"github.com/cockroachdb/cockroach/util"
+)
+
+// BootstrapInfo is the persistent state a node stores across restarts so
+// that it can reconnect to the gossip network without relying solely on
+// its statically configured resolvers. Addresses holds the flat list of
+// peer addresses known at the time of the last write; Buckets holds the
+// same contacts grouped by Kademlia XOR-distance bucket, so a restarting
+// node can reconnect through a distance-balanced subset rather than an
+// arbitrary one.
+type BootstrapInfo struct {
+	Addresses []util.UnresolvedAddr
+	Buckets   []BootstrapBucket
+
+	// SignerKey is the Ed25519 public key of the node that produced this
+	// BootstrapInfo, and Signature is its signature over Addresses and
+	// Buckets. Together they let a node detect that Addresses/Buckets
+	// were altered since they were signed -- by default that's the only
+	// guarantee: the signer generates a fresh key every time it starts
+	// (see newSigningKey), so nothing yet pins SignerKey to a value an
+	// operator actually trusts, and a party with write access to the
+	// storage backend can mint its own key pair and sign a forged
+	// BootstrapInfo that verifies cleanly. Gossip.SetTrustedSigners lets
+	// an operator restrict acceptance to known keys once a real
+	// distribution mechanism for those keys (e.g. the cluster CA)
+	// exists, but nothing in this package provides one yet.
+	SignerKey []byte
+	Signature []byte
+}
+
+// BootstrapBucket is the persisted form of a single k-bucket: the
+// contacts a node had recorded at a given XOR-distance index from
+// itself.
+type BootstrapBucket struct {
+	Index    int
+	Contacts []util.UnresolvedAddr
+}
+
+// Reset implements the proto.Message interface.
+func (bi *BootstrapInfo) Reset() { *bi = BootstrapInfo{} }
+
+// String implements the proto.Message interface.
+func (bi *BootstrapInfo) String() string { return fmt.Sprintf("%+v", *bi) }
+
+// ProtoMessage implements the proto.Message interface.
+func (*BootstrapInfo) ProtoMessage() {}
+
+// Storage is the interface used by Gossip to read and write
+// BootstrapInfo to a persistent medium. Implementations are free to
+// store the information locally (e.g. a file on the node's own disk) or
+// in a store shared across the cluster. See the gossip/storage package
+// for a registry of pluggable backends selected by URL scheme, so a
+// node can be pointed at a shared store without gossip depending on any
+// particular one.
+type Storage interface {
+	// ReadBootstrapInfo fetches the persisted bootstrap info into info.
+	ReadBootstrapInfo(info *BootstrapInfo) error
+	// WriteBootstrapInfo persists info, overwriting anything previously
+	// stored.
+	WriteBootstrapInfo(info *BootstrapInfo) error
+}
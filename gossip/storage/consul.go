@@ -0,0 +1,107 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/cockroachdb/cockroach/gossip"
+)
+
+func init() {
+	Register("consul", newConsulStorage)
+}
+
+// consulStorage stores BootstrapInfo as a single JSON-encoded value in
+// Consul's KV store, shared by every node in the cluster. It talks to
+// Consul's HTTP API directly rather than depending on a client library.
+type consulStorage struct {
+	baseURL string // e.g. "http://host:8500/v1/kv/cockroach/bootstrap"
+	client  *http.Client
+}
+
+// newConsulStorage implements Factory for the "consul" scheme. A URL of
+// "consul://host:8500/cockroach/bootstrap" addresses the KV key
+// "cockroach/bootstrap" on the Consul agent at host:8500.
+func newConsulStorage(rawurl string) (gossip.Storage, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("consul storage: %q has no host", rawurl)
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if key == "" {
+		return nil, fmt.Errorf("consul storage: %q has no key", rawurl)
+	}
+	return &consulStorage{
+		baseURL: fmt.Sprintf("http://%s/v1/kv/%s", u.Host, key),
+		client:  http.DefaultClient,
+	}, nil
+}
+
+// ReadBootstrapInfo implements gossip.Storage.
+func (cs *consulStorage) ReadBootstrapInfo(info *gossip.BootstrapInfo) error {
+	resp, err := cs.client.Get(cs.baseURL + "?raw")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		*info = gossip.BootstrapInfo{}
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("consul storage: GET %s: unexpected status %s", cs.baseURL, resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if len(body) == 0 {
+		*info = gossip.BootstrapInfo{}
+		return nil
+	}
+	return json.Unmarshal(body, info)
+}
+
+// WriteBootstrapInfo implements gossip.Storage.
+func (cs *consulStorage) WriteBootstrapInfo(info *gossip.BootstrapInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, cs.baseURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp, err := cs.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("consul storage: PUT %s: unexpected status %s", cs.baseURL, resp.Status)
+	}
+	return nil
+}
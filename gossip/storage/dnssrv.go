@@ -0,0 +1,76 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+
+	"github.com/cockroachdb/cockroach/gossip"
+	"github.com/cockroachdb/cockroach/util"
+)
+
+func init() {
+	Register("dns+srv", newDNSSRVStorage)
+}
+
+// dnsSRVStorage resolves bootstrap addresses from DNS SRV records
+// (e.g. those published by a Kubernetes headless service), such as
+// "_cockroach._tcp.example.com". It has no way to publish SRV records
+// itself, so WriteBootstrapInfo is unsupported; the cluster's own DNS
+// zone is the source of truth. The BootstrapInfo it reads carries no
+// signature, so Gossip.SetStorage, which rejects unsigned addresses,
+// does not seed its routing table from it.
+type dnsSRVStorage struct {
+	name string
+}
+
+// newDNSSRVStorage implements Factory for the "dns+srv" scheme. The
+// URL's host is used verbatim as the SRV record name to look up, e.g.
+// "dns+srv://_cockroach._tcp.example.com".
+func newDNSSRVStorage(rawurl string) (gossip.Storage, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("dns+srv storage: %q has no SRV record name", rawurl)
+	}
+	return &dnsSRVStorage{name: u.Host}, nil
+}
+
+// ReadBootstrapInfo implements gossip.Storage by issuing a live SRV
+// lookup; it does not cache between calls, since DNS TTLs already
+// provide that.
+func (ds *dnsSRVStorage) ReadBootstrapInfo(info *gossip.BootstrapInfo) error {
+	_, records, err := net.LookupSRV("", "", ds.name)
+	if err != nil {
+		return err
+	}
+	*info = gossip.BootstrapInfo{}
+	for _, r := range records {
+		hostPort := net.JoinHostPort(r.Target, strconv.Itoa(int(r.Port)))
+		info.Addresses = append(info.Addresses, util.MakeUnresolvedAddr("tcp", hostPort))
+	}
+	return nil
+}
+
+// WriteBootstrapInfo implements gossip.Storage. DNS SRV is a read-only
+// backend from gossip's perspective.
+func (ds *dnsSRVStorage) WriteBootstrapInfo(*gossip.BootstrapInfo) error {
+	return fmt.Errorf("dns+srv storage %q is read-only", ds.name)
+}
@@ -0,0 +1,119 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/cockroachdb/cockroach/gossip"
+)
+
+func init() {
+	Register("etcd", newEtcdStorage)
+}
+
+// etcdKeyResponse is the subset of etcd's v2 keys-API response we need.
+type etcdKeyResponse struct {
+	Node struct {
+		Value string `json:"value"`
+	} `json:"node"`
+}
+
+// etcdStorage stores BootstrapInfo as a single JSON-encoded value under
+// an etcd key, shared by every node in the cluster, via etcd's v2 HTTP
+// keys API.
+type etcdStorage struct {
+	keyURL string // e.g. "http://host:2379/v2/keys/cockroach/bootstrap"
+	client *http.Client
+}
+
+// newEtcdStorage implements Factory for the "etcd" scheme. A URL of
+// "etcd://host:2379/cockroach/bootstrap" addresses the key
+// "/cockroach/bootstrap" on the etcd cluster member at host:2379.
+func newEtcdStorage(rawurl string) (gossip.Storage, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("etcd storage: %q has no host", rawurl)
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if key == "" {
+		return nil, fmt.Errorf("etcd storage: %q has no key", rawurl)
+	}
+	return &etcdStorage{
+		keyURL: fmt.Sprintf("http://%s/v2/keys/%s", u.Host, key),
+		client: http.DefaultClient,
+	}, nil
+}
+
+// ReadBootstrapInfo implements gossip.Storage.
+func (es *etcdStorage) ReadBootstrapInfo(info *gossip.BootstrapInfo) error {
+	resp, err := es.client.Get(es.keyURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		*info = gossip.BootstrapInfo{}
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("etcd storage: GET %s: unexpected status %s", es.keyURL, resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var kr etcdKeyResponse
+	if err := json.Unmarshal(body, &kr); err != nil {
+		return err
+	}
+	if kr.Node.Value == "" {
+		*info = gossip.BootstrapInfo{}
+		return nil
+	}
+	return json.Unmarshal([]byte(kr.Node.Value), info)
+}
+
+// WriteBootstrapInfo implements gossip.Storage.
+func (es *etcdStorage) WriteBootstrapInfo(info *gossip.BootstrapInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	form := url.Values{"value": {string(data)}}
+	req, err := http.NewRequest(http.MethodPut, es.keyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := es.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("etcd storage: PUT %s: unexpected status %s", es.keyURL, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/cockroachdb/cockroach/gossip"
+)
+
+func init() {
+	Register("file", newFileStorage)
+}
+
+// fileStorage is the default backend: BootstrapInfo persisted as JSON
+// in a single file local to this node. It predates the registry and
+// remains the fallback for single-node or non-shared deployments.
+type fileStorage struct {
+	mu   sync.Mutex
+	path string
+}
+
+// newFileStorage implements Factory for the "file" scheme. A URL of
+// "file:///var/lib/cockroach/bootstrap.json" resolves to that absolute
+// path.
+func newFileStorage(rawurl string) (gossip.Storage, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	return &fileStorage{path: u.Path}, nil
+}
+
+// ReadBootstrapInfo implements gossip.Storage.
+func (fs *fileStorage) ReadBootstrapInfo(info *gossip.BootstrapInfo) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	data, err := ioutil.ReadFile(fs.path)
+	if os.IsNotExist(err) {
+		*info = gossip.BootstrapInfo{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, info)
+}
+
+// WriteBootstrapInfo implements gossip.Storage.
+func (fs *fileStorage) WriteBootstrapInfo(info *gossip.BootstrapInfo) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fs.path, data, 0644)
+}
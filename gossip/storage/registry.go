@@ -0,0 +1,91 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package storage is a small registry of gossip.Storage backends,
+// selected by URL scheme. It lets operators point a node's bootstrap
+// persistence at a store shared across the cluster (etcd, Consul,
+// DNS SRV records) instead of the default per-node local file, without
+// gossip itself needing to know about any particular backend.
+//
+// A backend registers itself under a scheme with Register, typically
+// from an init function in its own file:
+//
+//	func init() {
+//		storage.Register("consul", newConsulStorage)
+//	}
+//
+// Callers obtain a gossip.Storage for a URL such as
+// "etcd://host:2379/cockroach/bootstrap" or
+// "dns+srv://_cockroach._tcp.example.com" with Open, then hand it to
+// gossip.Gossip.SetStorage:
+//
+//	s, err := storage.Open(bootstrapURL)
+//	if err != nil {
+//		return err
+//	}
+//	if err := g.SetStorage(s); err != nil {
+//		return err
+//	}
+package storage
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+
+	"github.com/cockroachdb/cockroach/gossip"
+)
+
+// Factory constructs a gossip.Storage from the raw URL it was selected
+// by. Implementations typically parse rawurl themselves (via
+// url.Parse) to recover host, path, and query parameters.
+type Factory func(rawurl string) (gossip.Storage, error)
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]Factory{}
+)
+
+// Register associates a URL scheme with a Factory. Register panics if
+// scheme is already registered, mirroring the pattern used by
+// database/sql and similar stdlib registries; it is meant to be called
+// from package init functions, not dynamically at runtime.
+func Register(scheme string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[scheme]; ok {
+		panic(fmt.Sprintf("storage: Register called twice for scheme %q", scheme))
+	}
+	registry[scheme] = factory
+}
+
+// Open parses rawurl and dispatches to the Factory registered for its
+// scheme, returning a ready-to-use gossip.Storage.
+func Open(rawurl string) (gossip.Storage, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("storage: invalid bootstrap storage URL %q: %v", rawurl, err)
+	}
+	if u.Scheme == "" {
+		return nil, fmt.Errorf("storage: bootstrap storage URL %q has no scheme", rawurl)
+	}
+
+	registryMu.Lock()
+	factory, ok := registry[u.Scheme]
+	registryMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("storage: no backend registered for scheme %q", u.Scheme)
+	}
+	return factory(rawurl)
+}
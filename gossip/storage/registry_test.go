@@ -0,0 +1,55 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import "testing"
+
+// TestOpenUnknownScheme verifies that Open reports a clear error for a
+// scheme no backend has registered for, rather than panicking or
+// silently returning a nil Storage.
+func TestOpenUnknownScheme(t *testing.T) {
+	if _, err := Open("bogus://host/path"); err == nil {
+		t.Fatal("expected an error for an unregistered scheme")
+	}
+}
+
+// TestOpenDispatchesByScheme verifies that Open routes to the factory
+// registered for each built-in scheme.
+func TestOpenDispatchesByScheme(t *testing.T) {
+	for _, rawurl := range []string{
+		"file:///tmp/bootstrap.json",
+		"etcd://127.0.0.1:2379/cockroach/bootstrap",
+		"consul://127.0.0.1:8500/cockroach/bootstrap",
+		"dns+srv://_cockroach._tcp.example.com",
+	} {
+		if _, err := Open(rawurl); err != nil {
+			t.Errorf("Open(%q) returned unexpected error: %v", rawurl, err)
+		}
+	}
+}
+
+// TestOpenRejectsMissingKey verifies backends that key off the URL path
+// reject a URL with no path component instead of silently operating on
+// an empty key.
+func TestOpenRejectsMissingKey(t *testing.T) {
+	for _, rawurl := range []string{
+		"etcd://127.0.0.1:2379",
+		"consul://127.0.0.1:8500",
+	} {
+		if _, err := Open(rawurl); err == nil {
+			t.Errorf("Open(%q): expected error for missing key", rawurl)
+		}
+	}
+}
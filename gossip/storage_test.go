@@ -188,4 +188,175 @@ func TestGossipStorage(t *testing.T) {
 			return true
 		}
 	})
+
+	// Tampering case: take a legitimately signed BootstrapInfo and
+	// mutate its addresses after the fact, as an adversary with write
+	// access to the storage backend might. A node given this tampered
+	// info must refuse to bootstrap through it.
+	var ts3 testStorage
+	if err := stores[0].ReadBootstrapInfo(&ts3.info); err != nil {
+		t.Fatal(err)
+	}
+	if len(ts3.info.Addresses) == 0 {
+		t.Fatal("expected at least one signed address to tamper with")
+	}
+	ts3.info.Addresses[0] = util.MakeUnresolvedAddr("tcp", "attacker.example.com:26257")
+
+	tamperedNode, err := network.CreateNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tamperedNode.Gossip.SetBootstrapInterval(1 * time.Millisecond)
+	if err := tamperedNode.Gossip.SetStorage(&ts3); err != nil {
+		t.Fatal(err)
+	}
+	if err := network.StartNode(tamperedNode); err != nil {
+		t.Fatal(err)
+	}
+	defer network.StopNode(tamperedNode)
+
+	select {
+	case <-time.After(20 * time.Millisecond):
+		// expected outcome: the tampered signature failed to verify, so
+		// there was nothing left to bootstrap through.
+	case <-tamperedNode.Gossip.Connected:
+		t.Fatal("unexpectedly connected to gossip using tampered bootstrap addresses")
+	}
+}
+
+// TestGossipStorageKademliaBuckets verifies that BootstrapInfo persists
+// contacts grouped into multiple XOR-distance buckets rather than an
+// unstructured address list, and that a rejoining node can reconnect
+// using only those bucketed contacts.
+func TestGossipStorageKademliaBuckets(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	network := simulation.NewNetwork(5)
+	defer network.Stop()
+
+	stores := make([]*testStorage, len(network.Nodes))
+	for i, n := range network.Nodes {
+		stores[i] = new(testStorage)
+		if err := n.Gossip.SetStorage(stores[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	network.RunUntilFullyConnected()
+
+	util.SucceedsSoon(t, func() error {
+		for _, p := range stores {
+			if p.Len() != len(network.Nodes)-1 {
+				return util.Errorf("incorrect number of addresses: expected %d; got %d", len(network.Nodes)-1, p.Len())
+			}
+		}
+		return nil
+	})
+
+	for i, p := range stores {
+		p.Lock()
+		buckets := p.info.Buckets
+		p.Unlock()
+		if len(buckets) < 2 {
+			t.Errorf("%d: expected contacts spread across multiple buckets, got %d bucket(s)", i, len(buckets))
+		}
+	}
+
+	// Create an unaffiliated node whose only path back into the cluster
+	// is the bucketed contacts recovered from a peer's persisted
+	// BootstrapInfo -- no resolver is ever configured for it.
+	node, err := network.CreateNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	node.Gossip.SetBootstrapInterval(1 * time.Millisecond)
+
+	var ts2 testStorage
+	if err := stores[0].ReadBootstrapInfo(&ts2.info); err != nil {
+		t.Fatal(err)
+	}
+	if len(ts2.info.Buckets) < 2 {
+		t.Fatalf("expected recovered bootstrap info to span multiple buckets, got %d", len(ts2.info.Buckets))
+	}
+	if err := node.Gossip.SetStorage(&ts2); err != nil {
+		t.Fatal(err)
+	}
+	if err := network.StartNode(node); err != nil {
+		t.Fatal(err)
+	}
+
+	network.SimulateNetwork(func(cycle int, network *simulation.Network) bool {
+		if cycle > 1000 {
+			t.Fatal("failed to connect to gossip using only bucketed contacts")
+		}
+		select {
+		case <-node.Gossip.Connected:
+			return false
+		default:
+			return true
+		}
+	})
+}
+
+// TestGossipBootstrapPolicyPromotesLiveAddresses verifies that a node
+// bootstrapping from a persisted address set containing several
+// addresses that are no longer reachable still connects within a
+// bounded number of cycles, because its bootstrap policy's scorer
+// deprioritizes addresses that have recently failed to dial in favor of
+// ones that haven't.
+func TestGossipBootstrapPolicyPromotesLiveAddresses(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	network := simulation.NewNetwork(6)
+	defer network.Stop()
+
+	var seed testStorage
+	if err := network.Nodes[0].Gossip.SetStorage(&seed); err != nil {
+		t.Fatal(err)
+	}
+
+	network.RunUntilFullyConnected()
+
+	// Node 0's persisted BootstrapInfo now names every other node.
+	// Take down all but one of them, leaving a bootstrap set that is
+	// mostly stale.
+	for _, n := range network.Nodes[1:5] {
+		network.StopNode(n)
+	}
+
+	joining, err := network.CreateNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	joining.Gossip.SetBootstrapPolicy(gossip.BootstrapPolicy{
+		MinInterval:         time.Millisecond,
+		MaxInterval:         10 * time.Millisecond,
+		MaxAttemptsPerCycle: 2,
+	})
+
+	var ts testStorage
+	if err := seed.ReadBootstrapInfo(&ts.info); err != nil {
+		t.Fatal(err)
+	}
+	if len(ts.info.Addresses) < 5 {
+		t.Fatalf("expected bootstrap info naming 5 peers, got %d", len(ts.info.Addresses))
+	}
+	if err := joining.Gossip.SetStorage(&ts); err != nil {
+		t.Fatal(err)
+	}
+	if err := network.StartNode(joining); err != nil {
+		t.Fatal(err)
+	}
+
+	network.SimulateNetwork(func(cycle int, network *simulation.Network) bool {
+		if cycle > 1000 {
+			t.Fatal("failed to connect to gossip despite a live address being available")
+		}
+		select {
+		case <-joining.Gossip.Connected:
+			return false
+		default:
+			return true
+		}
+	})
 }